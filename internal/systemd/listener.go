@@ -0,0 +1,117 @@
+// Copyright 2018 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be found
+// in the LICENSE file.
+
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Any inspects the Socket's underlying file descriptor with SO_TYPE and
+// SO_ACCEPTCONN, the way systemd's own sd_is_socket_* helpers do, and
+// returns it as the most specific net type for what it actually is: a
+// net.Listener for a listening stream or seqpacket socket, a net.Conn for a
+// connected stream socket, or a net.PacketConn for a datagram or
+// unconnected seqpacket socket.
+func (s Socket) Any() (interface{}, error) {
+	fd := int(s.Fd())
+
+	typ, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return nil, fmt.Errorf("systemd: SO_TYPE: %v", err)
+	}
+
+	switch typ {
+	case syscall.SOCK_STREAM, syscall.SOCK_SEQPACKET:
+		listening, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+		if err != nil {
+			return nil, fmt.Errorf("systemd: SO_ACCEPTCONN: %v", err)
+		}
+
+		if listening == 1 {
+			return s.Listener()
+		}
+
+		return s.Conn()
+
+	case syscall.SOCK_DGRAM:
+		return s.PacketConn()
+
+	default:
+		return nil, fmt.Errorf("systemd: unsupported socket type %d", typ)
+	}
+}
+
+// Listeners returns a net.Listener for every socket inherited from systemd
+// that is a listening stream or seqpacket socket, in the order given by
+// LISTEN_FDS. Inherited fds of any other kind (UDP sockets, connected
+// stream sockets, FIFOs, ...) are skipped, so callers can use it regardless
+// of whether the unit also lists non-listening or non-socket entries:
+//
+//	ls, err := systemd.Listeners()
+//	http.Serve(ls[0], handler)
+func Listeners() ([]net.Listener, error) {
+	sockets, err := Listen()
+	if err != nil {
+		return nil, err
+	}
+
+	var listeners []net.Listener
+	for _, s := range sockets {
+		any, err := s.Any()
+		if err != nil {
+			// Not every inherited fd is necessarily a socket (e.g. a
+			// unit can also pass FIFOs); skip anything Any can't
+			// classify instead of failing the whole lookup.
+			continue
+		}
+
+		if l, ok := any.(net.Listener); ok {
+			listeners = append(listeners, l)
+		}
+	}
+
+	return listeners, nil
+}
+
+// PacketConns returns a net.PacketConn for every socket inherited from
+// systemd that is a datagram, or unconnected seqpacket, socket, in the
+// order given by LISTEN_FDS. Inherited sockets of any other kind are
+// skipped.
+func PacketConns() ([]net.PacketConn, error) {
+	sockets, err := Listen()
+	if err != nil {
+		return nil, err
+	}
+
+	var conns []net.PacketConn
+	for _, s := range sockets {
+		any, err := s.Any()
+		if err != nil {
+			// See the matching skip in Listeners.
+			continue
+		}
+
+		c, ok := any.(net.PacketConn)
+		if !ok {
+			continue
+		}
+
+		// *net.UnixConn satisfies net.PacketConn even for a connected UNIX
+		// stream or seqpacket socket, so the fd's own kind decides.
+		fd := int(s.Fd())
+		typ, _ := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+		_, peerErr := syscall.Getpeername(fd)
+		if typ == syscall.SOCK_STREAM || (typ == syscall.SOCK_SEQPACKET && peerErr == nil) {
+			c.Close()
+			continue
+		}
+
+		conns = append(conns, c)
+	}
+
+	return conns, nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2018 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be found
+// in the LICENSE file.
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// swapFD temporarily replaces the socket underneath fd with a duplicate of
+// replacement's, returning a func that restores whatever fd originally
+// pointed at. It sticks to fdStart/fdStart+1 deliberately: those are the
+// only descriptors the rest of the package's tests rely on being stable,
+// and unlike higher fds they're claimed well before Go's runtime network
+// poller picks one of its own, so swapping them doesn't risk colliding
+// with it.
+func swapFD(t *testing.T, fd int, replacement *os.File) (restore func()) {
+	t.Helper()
+
+	save, err := syscall.Dup(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Dup2(int(replacement.Fd()), fd); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		syscall.Dup2(save, fd)
+		syscall.Close(save)
+	}
+}
+
+func TestListenersAndPacketConns(t *testing.T) {
+	prepareEnv(t, true, true, true)
+	defer cleanEnv(r, w)
+
+	l, err := net.Listen("tcp", ":55561")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	defer lf.Close()
+	defer swapFD(t, fdStart, lf)()
+
+	pc, err := net.ListenPacket("udp", ":55562")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := pc.(*net.UDPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	defer pf.Close()
+	defer swapFD(t, fdStart+1, pf)()
+
+	listeners, err := Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range listeners {
+		defer l.Close()
+	}
+	if len(listeners) != 1 {
+		t.Fatalf("unexpected number of listeners: expected 1, got %d", len(listeners))
+	}
+
+	Reset()
+
+	conns, err := PacketConns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range conns {
+		defer c.Close()
+	}
+	if len(conns) != 1 {
+		t.Fatalf("unexpected number of packet conns: expected 1, got %d", len(conns))
+	}
+}
+
+// TestListenersSkipsNonSockets exercises the all-non-socket case: the
+// shared r/w pipe is never a socket at all, so both Listeners and
+// PacketConns should come back empty without error instead of failing on
+// the first fd SO_TYPE can't classify.
+func TestListenersSkipsNonSockets(t *testing.T) {
+	prepareEnv(t, true, true, true)
+	defer cleanEnv(r, w)
+
+	listeners, err := Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 0 {
+		t.Fatalf("expected no listeners among non-socket fds, got %d", len(listeners))
+	}
+
+	Reset()
+
+	conns, err := PacketConns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 0 {
+		t.Fatalf("expected no packet conns among non-socket fds, got %d", len(conns))
+	}
+}
+
+func TestSocketAnyListener(t *testing.T) {
+	l1, err := net.Listen("tcp", ":55558")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+
+	f, err := l1.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSocket(int(f.Fd()), f.Name())
+
+	any, err := s.Any()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l2, ok := any.(net.Listener)
+	if !ok {
+		t.Fatalf("expected a net.Listener, got %T", any)
+	}
+
+	if err = l2.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSocketAnySeqpacketConn covers a connected SOCK_SEQPACKET socket, which
+// Any must hand back as a net.Conn rather than a net.PacketConn: unlike a
+// connectionless unixgram socket, a connected unixpacket fd's ReadFrom and
+// WriteTo aren't usable through net.FilePacketConn.
+func TestSocketAnySeqpacketConn(t *testing.T) {
+	addr := "/tmp/helgrind-seqpacket-test.sock"
+	os.Remove(addr)
+
+	l1, err := net.Listen("unixpacket", addr)
+	if err != nil {
+		t.Skipf("unixpacket not supported: %v", err)
+	}
+	defer l1.Close()
+	defer os.Remove(addr)
+
+	accepted := make(chan struct{})
+	go func() {
+		c, err := l1.Accept()
+		if err == nil {
+			defer c.Close()
+		}
+		close(accepted)
+	}()
+
+	c1, err := net.Dial("unixpacket", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-accepted
+
+	f, err := c1.(*net.UnixConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSocket(int(f.Fd()), f.Name())
+
+	any, err := s.Any()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, ok := any.(net.Conn)
+	if !ok {
+		t.Fatalf("expected a net.Conn, got %T", any)
+	}
+
+	if err = c2.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSocketAnyConn(t *testing.T) {
+	l1, err := net.Listen("tcp", ":55559")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+
+	c1, err := net.Dial("tcp", ":55559")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	f, err := c1.(*net.TCPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSocket(int(f.Fd()), f.Name())
+
+	any, err := s.Any()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, ok := any.(net.Conn)
+	if !ok {
+		t.Fatalf("expected a net.Conn, got %T", any)
+	}
+
+	if err = c2.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSocketAnyPacketConn(t *testing.T) {
+	c1, err := net.ListenPacket("udp", ":55560")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+
+	f, err := c1.(*net.UDPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSocket(int(f.Fd()), f.Name())
+
+	any, err := s.Any()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, ok := any.(net.PacketConn)
+	if !ok {
+		t.Fatalf("expected a net.PacketConn, got %T", any)
+	}
+
+	if err = c2.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2018 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be found
+// in the LICENSE file.
+
+package systemd
+
+// ListenByName returns the sockets inherited from systemd whose
+// FileDescriptorName= equals name, in the order given by LISTEN_FDS. It
+// returns a nil slice, not an error, if no inherited socket has that name.
+func ListenByName(name string) ([]Socket, error) {
+	all, err := ListenWithNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Socket
+	for _, s := range all {
+		if s.Name() == name {
+			found = append(found, s)
+		}
+	}
+
+	return found, nil
+}
+
+// ListenersByName returns every socket inherited from systemd, grouped by
+// its FileDescriptorName=. Sockets from a unit that doesn't set
+// FileDescriptorName= are grouped under the empty string.
+func ListenersByName() (map[string][]Socket, error) {
+	all, err := ListenWithNames()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]Socket)
+	for _, s := range all {
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+
+	return byName, nil
+}
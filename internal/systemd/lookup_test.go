@@ -0,0 +1,45 @@
+// Copyright 2018 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be found
+// in the LICENSE file.
+
+package systemd
+
+import (
+	"os"
+	"testing"
+)
+
+// TestListenByName exercises ListenByName and ListenersByName together.
+func TestListenByName(t *testing.T) {
+	prepareEnv(t, true, true, true)
+	os.Setenv("LISTEN_FDNAMES", "public:admin")
+	defer cleanEnv(r, w)
+
+	public, err := ListenByName("public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(public) != 1 || public[0].Fd() != r.Fd() {
+		t.Fatalf("unexpected sockets for name \"public\": %v", public)
+	}
+
+	admin, err := ListenByName("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(admin) != 1 || admin[0].Fd() != w.Fd() {
+		t.Fatalf("unexpected sockets for name \"admin\": %v", admin)
+	}
+
+	if missing, err := ListenByName("missing"); err != nil || len(missing) != 0 {
+		t.Fatalf("expected no sockets for an unknown name, got %v, err %v", missing, err)
+	}
+
+	byName, err := ListenersByName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byName) != 2 || len(byName["public"]) != 1 || len(byName["admin"]) != 1 {
+		t.Fatalf("unexpected grouping: %v", byName)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be found
+// in the LICENSE file.
+
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends state, a newline-separated sequence of key=value pairs, to
+// the service manager over the datagram socket named by NOTIFY_SOCKET. It
+// implements the sd_notify(3) protocol used by units with Type=notify and
+// by WatchdogSec=.
+//
+// If NOTIFY_SOCKET is unset, Notify is a no-op that returns nil, so callers
+// can invoke it unconditionally whether or not the process was started by
+// systemd.
+func Notify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+
+	// A leading "@" denotes the Linux abstract socket namespace; the
+	// syscall package substitutes the required NUL byte for it.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("systemd: dial NOTIFY_SOCKET: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("systemd: notify: %v", err)
+	}
+
+	return nil
+}
+
+// Ready tells the service manager that service startup, or configuration
+// reload, has finished.
+func Ready() error {
+	return Notify("READY=1")
+}
+
+// Reloading tells the service manager that the service is reloading its
+// configuration. Callers must send Ready once reloading has completed.
+func Reloading() error {
+	return Notify("RELOADING=1")
+}
+
+// Stopping tells the service manager that the service is beginning its
+// shutdown.
+func Stopping() error {
+	return Notify("STOPPING=1")
+}
+
+// Status updates the service's free-form status string, as shown by e.g.
+// `systemctl status`.
+func Status(msg string) error {
+	return Notify("STATUS=" + msg)
+}
+
+// Watchdog tells the service manager that the service is still alive, in
+// response to WatchdogSec=. Call it periodically at the interval returned
+// by WatchdogEnabled.
+func Watchdog() error {
+	return Notify("WATCHDOG=1")
+}
+
+// WatchdogEnabled reports whether the service manager expects periodic
+// watchdog pings, as configured by WatchdogSec=, by reading WATCHDOG_USEC
+// and WATCHDOG_PID. If the watchdog is enabled, it returns the suggested
+// interval at which Watchdog should be called, half of the configured
+// timeout so that a missed ping doesn't immediately trip it.
+//
+// If WATCHDOG_PID does not match the calling process, or the watchdog
+// variables are unset, WatchdogEnabled returns a zero duration and a nil
+// error: the watchdog is simply not enabled for this process.
+func WatchdogEnabled() (time.Duration, error) {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	pidStr := os.Getenv("WATCHDOG_PID")
+
+	if usecStr == "" || pidStr == "" {
+		return 0, nil
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return 0, fmt.Errorf("systemd: invalid WATCHDOG_PID %q: %v", pidStr, err)
+	}
+
+	if pid != os.Getpid() {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("systemd: invalid WATCHDOG_USEC %q: %v", usecStr, err)
+	}
+
+	if usec <= 0 {
+		return 0, fmt.Errorf("systemd: WATCHDOG_USEC must be positive, got %d", usec)
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be found
+// in the LICENSE file.
+
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotifyNoSocket(t *testing.T) {
+	os.Clearenv()
+
+	if err := Notify("READY=1"); err != nil {
+		t.Fatalf("expected no-op when NOTIFY_SOCKET is unset, got: %v", err)
+	}
+
+	if err := Ready(); err != nil {
+		t.Fatalf("expected no-op when NOTIFY_SOCKET is unset, got: %v", err)
+	}
+}
+
+// readNotify reads a single datagram from conn, failing the test if none
+// arrives promptly.
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	buf := make([]byte, 1024)
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-notify-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Clearenv()
+	os.Setenv("NOTIFY_SOCKET", addr)
+
+	if err := Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "READY=1" {
+		t.Fatalf("unexpected payload: expected %q, got %q", "READY=1", got)
+	}
+
+	if err := Status("running fine"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "STATUS=running fine" {
+		t.Fatalf("unexpected payload: expected %q, got %q", "STATUS=running fine", got)
+	}
+
+	if err := Watchdog(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "WATCHDOG=1" {
+		t.Fatalf("unexpected payload: expected %q, got %q", "WATCHDOG=1", got)
+	}
+
+	if err := Reloading(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "RELOADING=1" {
+		t.Fatalf("unexpected payload: expected %q, got %q", "RELOADING=1", got)
+	}
+
+	if err := Stopping(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "STOPPING=1" {
+		t.Fatalf("unexpected payload: expected %q, got %q", "STOPPING=1", got)
+	}
+}
+
+func TestNotifyAbstract(t *testing.T) {
+	addr := "@helgrind-notify-test-" + strconv.Itoa(os.Getpid())
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Clearenv()
+	os.Setenv("NOTIFY_SOCKET", addr)
+
+	if err := Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "READY=1" {
+		t.Fatalf("unexpected payload: expected %q, got %q", "READY=1", got)
+	}
+}
+
+func TestWatchdogEnabledUnset(t *testing.T) {
+	os.Clearenv()
+
+	d, err := WatchdogEnabled()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d != 0 {
+		t.Fatalf("expected watchdog disabled, got interval %v", d)
+	}
+}
+
+func TestWatchdogEnabledWrongPID(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	os.Setenv("WATCHDOG_PID", "1")
+
+	d, err := WatchdogEnabled()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d != 0 {
+		t.Fatalf("expected watchdog disabled for a foreign PID, got interval %v", d)
+	}
+}
+
+func TestWatchdogEnabledInvalidUsec(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("WATCHDOG_USEC", "Gordon")
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	if _, err := WatchdogEnabled(); err == nil {
+		t.Fatal("did not fail on invalid WATCHDOG_USEC")
+	}
+}
+
+func TestWatchdogEnabled(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	d, err := WatchdogEnabled()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := 15 * time.Second; d != want {
+		t.Fatalf("unexpected watchdog interval: expected %v, got %v", want, d)
+	}
+}
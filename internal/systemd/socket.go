@@ -0,0 +1,261 @@
+// Copyright 2018 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a MIT-style license that can be found
+// in the LICENSE file.
+
+// Package systemd implements the client side of systemd's socket activation
+// protocol, as described in sd_listen_fds(3). It lets a service accept
+// sockets opened and bound by systemd instead of doing so itself, which
+// allows systemd to start the service on demand and to keep sockets open
+// across restarts.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fdStart is the number of the first file descriptor passed to a process by
+// systemd via socket activation. File descriptors 0-2 are reserved for
+// stdin, stdout and stderr.
+const fdStart = 3
+
+// files and parseErr cache the result of parsing LISTEN_PID and LISTEN_FDS.
+// They are populated once, by parse, so that repeated calls to Listen are
+// cheap and keep handing out the very same *os.File for a given descriptor
+// instead of wrapping it again.
+//
+// namedSockets and namedErr are a separate cache for ListenWithNames, which
+// additionally validates and applies LISTEN_FDNAMES. Keeping it apart from
+// files means a caller that only uses Listen is never tripped up by a unit
+// with a misconfigured FileDescriptorName= count.
+var (
+	mu       sync.Mutex
+	parsed   bool
+	files    []*os.File
+	parseErr error
+
+	namedParsed  bool
+	namedSockets []Socket
+	namedErr     error
+)
+
+// Socket is a single file descriptor inherited from systemd via socket
+// activation.
+type Socket struct {
+	file *os.File
+}
+
+// newSocket wraps fd in a Socket, giving it the provided name.
+func newSocket(fd int, name string) Socket {
+	return Socket{file: os.NewFile(uintptr(fd), name)}
+}
+
+// File returns the *os.File backing the Socket.
+func (s Socket) File() *os.File {
+	return s.file
+}
+
+// Fd returns the Socket's file descriptor.
+func (s Socket) Fd() uintptr {
+	return s.file.Fd()
+}
+
+// Name returns the name systemd assigned the Socket via
+// FileDescriptorName=, or the empty string if none was set.
+func (s Socket) Name() string {
+	return s.file.Name()
+}
+
+// Close closes the Socket's underlying file descriptor.
+func (s Socket) Close() error {
+	return s.file.Close()
+}
+
+// Listener returns a net.Listener for the Socket. It is meant to be used
+// with stream oriented sockets (e.g. TCP or UNIX) that are already
+// listening.
+func (s Socket) Listener() (net.Listener, error) {
+	return net.FileListener(s.file)
+}
+
+// Conn returns a net.Conn for the Socket. It is meant to be used with
+// already connected stream oriented sockets.
+func (s Socket) Conn() (net.Conn, error) {
+	return net.FileConn(s.file)
+}
+
+// PacketConn returns a net.PacketConn for the Socket. It is meant to be used
+// with datagram oriented sockets (e.g. UDP or UNIX datagram sockets).
+func (s Socket) PacketConn() (net.PacketConn, error) {
+	return net.FilePacketConn(s.file)
+}
+
+// checkPID verifies that LISTEN_PID, as set by systemd, matches the PID of
+// the current process. This must hold before any of LISTEN_FDS or
+// LISTEN_FDNAMES may be trusted.
+func checkPID() error {
+	pidStr := os.Getenv("LISTEN_PID")
+	if pidStr == "" {
+		return fmt.Errorf("systemd: LISTEN_PID not set")
+	}
+
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return fmt.Errorf("systemd: invalid LISTEN_PID %q: %v", pidStr, err)
+	}
+
+	if pid != os.Getpid() {
+		return fmt.Errorf("systemd: LISTEN_PID %d does not match PID %d", pid, os.Getpid())
+	}
+
+	return nil
+}
+
+// numFDs returns the number of file descriptors passed to this process, as
+// set in LISTEN_FDS.
+func numFDs() (int, error) {
+	fdsStr := os.Getenv("LISTEN_FDS")
+	if fdsStr == "" {
+		return 0, fmt.Errorf("systemd: LISTEN_FDS not set")
+	}
+
+	n, err := strconv.Atoi(fdsStr)
+	if err != nil {
+		return 0, fmt.Errorf("systemd: invalid LISTEN_FDS %q: %v", fdsStr, err)
+	}
+
+	if n < 0 {
+		return 0, fmt.Errorf("systemd: invalid LISTEN_FDS %q: must not be negative", fdsStr)
+	}
+
+	return n, nil
+}
+
+// parse parses LISTEN_PID and LISTEN_FDS exactly once, caching the
+// resulting files under mu. It deliberately never looks at LISTEN_FDNAMES:
+// that validation is ListenWithNames' job, via parseNamed, so that a caller
+// who only wants Listen never fails because of a unit's misconfigured
+// FileDescriptorName= count.
+func parse() ([]*os.File, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return parseLocked()
+}
+
+// parseLocked does the work of parse. It must be called with mu held, so
+// that parseNamed can also call it without causing a recursive lock.
+func parseLocked() ([]*os.File, error) {
+	if parsed {
+		return files, parseErr
+	}
+	parsed = true
+
+	if parseErr = checkPID(); parseErr != nil {
+		return nil, parseErr
+	}
+
+	n, err := numFDs()
+	if err != nil {
+		parseErr = err
+		return nil, parseErr
+	}
+
+	fs := make([]*os.File, n)
+	for i := 0; i < n; i++ {
+		fs[i] = os.NewFile(uintptr(fdStart+i), "")
+	}
+
+	files = fs
+	return files, nil
+}
+
+// parseNamed builds on parseLocked's file descriptors, additionally
+// validating and applying LISTEN_FDNAMES. It caches its own result under mu
+// so that, like parse, it only reads the environment once.
+func parseNamed() ([]Socket, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if namedParsed {
+		return namedSockets, namedErr
+	}
+	namedParsed = true
+
+	fs, err := parseLocked()
+	if err != nil {
+		namedErr = err
+		return nil, namedErr
+	}
+
+	ns := make([]string, len(fs))
+	if namesStr, ok := os.LookupEnv("LISTEN_FDNAMES"); ok {
+		parts := strings.Split(namesStr, ":")
+		if len(parts) != len(fs) {
+			namedErr = fmt.Errorf("systemd: LISTEN_FDNAMES has %d names, expected %d", len(parts), len(fs))
+			return nil, namedErr
+		}
+		ns = parts
+	}
+
+	sockets := make([]Socket, len(fs))
+	for i, f := range fs {
+		sockets[i] = Socket{file: os.NewFile(f.Fd(), ns[i])}
+	}
+
+	namedSockets = sockets
+	return namedSockets, nil
+}
+
+// Reset discards the cached activation state, so that the next call to
+// Listen or ListenWithNames re-parses the environment. Production code has
+// no reason to call it; it exists so tests can exercise Listen and
+// ListenWithNames against more than one environment per process.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	parsed = false
+	files = nil
+	parseErr = nil
+
+	namedParsed = false
+	namedSockets = nil
+	namedErr = nil
+}
+
+// Listen returns the sockets passed to this process by systemd, in the
+// order given by LISTEN_FDS. It ignores LISTEN_FDNAMES entirely, so a unit
+// with a misconfigured FileDescriptorName= count doesn't break a caller
+// that never asked for names; use ListenWithNames for that. Calling Listen
+// more than once returns the same Socket slice every time.
+func Listen() ([]Socket, error) {
+	fs, err := parse()
+	if err != nil {
+		return nil, err
+	}
+
+	sockets := make([]Socket, len(fs))
+	for i, f := range fs {
+		sockets[i] = Socket{file: f}
+	}
+
+	return sockets, nil
+}
+
+// ListenWithNames returns the sockets passed to this process by systemd,
+// named according to LISTEN_FDNAMES.
+//
+// systemd only sets LISTEN_FDNAMES when the unit assigns a
+// FileDescriptorName= to at least one of its sockets; units that don't use
+// FileDescriptorName= at all leave it unset, in which case every socket is
+// returned with an empty name. If LISTEN_FDNAMES is set, its arity must
+// match LISTEN_FDS. Like Listen, repeated calls return the same Socket
+// slice.
+func ListenWithNames() ([]Socket, error) {
+	return parseNamed()
+}
@@ -14,11 +14,10 @@ import (
 	"testing"
 )
 
-// https://github.com/golang/go/commit/c05b06a12d005f50e4776095a60d6bd9c2c91fac
-// causes file descriptors to remain open after the first file I/O.
-// We therefore can not rely on only 2 open file descriptors in our tests and
-// have to use a workaround and open 2 file descriptors right at init and keep
-// reusing them.
+// r and w stand in for the descriptors systemd would pass at fdStart and
+// fdStart+1. They are opened once here, rather than per test, so that every
+// test observes the same pair of file descriptors regardless of how many
+// times Listen or ListenWithNames have already cached them.
 var r, w *os.File
 
 func init() {
@@ -66,6 +65,7 @@ func cleanEnv(r, w *os.File) {
 	os.Unsetenv("LISTEN_PID")
 	os.Unsetenv("LISTEN_FDS")
 	os.Unsetenv("LISTEN_FDNAMES")
+	Reset()
 }
 
 func checkWrite(w io.Writer, r io.Reader) (err error) {
@@ -148,6 +148,35 @@ func TestListenNoFDs(t *testing.T) {
 	}
 }
 
+func TestListenNegativeFDs(t *testing.T) {
+	prepareEnv(t, true, false, true)
+	os.Setenv("LISTEN_FDS", "-1")
+	defer cleanEnv(r, w)
+
+	if _, err := Listen(); err == nil {
+		t.Fatal("did not fail when FDs was negative")
+	}
+}
+
+// TestListenIgnoresBadFDNames exercises the whole reason Listen and
+// ListenWithNames exist as separate entry points: a caller that only uses
+// Listen shouldn't care whether the unit's FileDescriptorName= count
+// matches LISTEN_FDS.
+func TestListenIgnoresBadFDNames(t *testing.T) {
+	prepareEnv(t, true, true, true)
+	os.Setenv("LISTEN_FDNAMES", "onlyone")
+	defer cleanEnv(r, w)
+
+	sockets, err := Listen()
+	if err != nil {
+		t.Fatalf("Listen should ignore a malformed LISTEN_FDNAMES, got: %v", err)
+	}
+
+	if len(sockets) != 2 {
+		t.Fatalf("unexpected number of sockets: expected 2, got %d", len(sockets))
+	}
+}
+
 func checkListenWithNames(t *testing.T, names []string) {
 	prepareEnv(t, true, true, true)
 	os.Setenv("LISTEN_FDNAMES", strings.Join(names, ":"))
@@ -231,31 +260,53 @@ func TestListenWithNamesMismatch(t *testing.T) {
 	prepareEnv(t, true, true, true)
 	defer cleanEnv(r, w)
 
-	if _, err := ListenWithNames(); err == nil {
-		t.Fatal("no error when no names were set")
-	}
-
 	prepareNames(0)
 	if _, err := ListenWithNames(); err == nil {
-		t.Fatal("no error when no names were set")
+		t.Fatal("no error when LISTEN_FDNAMES was empty")
 	}
 
+	Reset()
 	prepareNames(1)
 	if _, err := ListenWithNames(); err == nil {
 		t.Fatal("no error when too few names were set")
 	}
 
+	Reset()
 	prepareNames(3)
 	if _, err := ListenWithNames(); err == nil {
 		t.Fatal("no error when too many names were set")
 	}
 }
 
+func TestListenWithNamesUnset(t *testing.T) {
+	prepareEnv(t, true, true, true)
+	defer cleanEnv(r, w)
+
+	sockets, err := ListenWithNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sockets) != 2 {
+		t.Fatalf("unexpected number of sockets: expected 2, got %d", len(sockets))
+	}
+
+	for i, s := range sockets {
+		if s.Name() != "" {
+			t.Fatalf("unexpected socket name at %d: expected empty, got %s", i, s.Name())
+		}
+	}
+
+	if r.Fd() != sockets[0].Fd() || w.Fd() != sockets[1].Fd() {
+		t.Fatalf("file descriptor mismatch: %d=%d, %d=%d", r.Fd(), sockets[0].Fd(), w.Fd(), sockets[1].Fd())
+	}
+}
+
 func TestSocket(t *testing.T) {
 	prepareEnv(t, false, false, true)
 	defer cleanEnv(r, w)
 
-	s := Socket{w}
+	s := Socket{file: w}
 
 	if s.Fd() != w.Fd() {
 		t.Fatalf("socket FD mismatch: expected %d, got %d", w.Fd(), s.Fd())